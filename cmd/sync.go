@@ -1,12 +1,26 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/hdu-dn11/wg-quick-op/quick"
 	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	syncResolveDynamic   bool
+	syncLazy             bool
+	syncLazyIdleTimeout  time.Duration
+	syncLazyPollInterval time.Duration
+)
+
 // syncCmd represents the sync command
 var syncCmd = &cobra.Command{
 	Use:   "sync (deprecated)",
@@ -15,19 +29,103 @@ var syncCmd = &cobra.Command{
 it may result in address added by PostUp being deleted.'`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
-			logrus.Errorln("up command requires exactly one interface name")
+			logrus.Errorln("sync command requires exactly one interface name")
 			return
 		}
+
+		// --resolve-dynamic and --lazy both need a goroutine that keeps
+		// running after this loop returns, so the command has to stay
+		// resident rather than exit immediately like a plain one-shot sync.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		background := false
+
 		cfgs := quick.MatchConfig(args[0])
 		for iface, cfg := range cfgs {
-			err := quick.Sync(cfg, iface, logrus.WithField("iface", iface))
+			entry := logrus.WithField("iface", iface)
+			err := quick.Sync(cfg, iface, entry)
 			if err != nil {
-				logrus.WithError(err).Errorln("failed to sync interface")
+				entry.WithError(err).Errorln("failed to sync interface")
+				continue
+			}
+
+			// Resolve hostname:port peers at least once up front whenever
+			// we might need the result, whether or not --resolve-dynamic
+			// keeps it running afterwards: SaveConfig draws on the same
+			// EndpointMap to avoid flattening a dynamic-DNS peer down to
+			// its last-resolved IP when rewriting the config file.
+			var resolver *quick.Resolver
+			if syncResolveDynamic || cfg.SaveConfig {
+				resolver = startResolver(iface, entry)
+			}
+			if syncResolveDynamic && resolver != nil {
+				go resolver.Run(ctx)
+				background = true
+			}
+
+			if cfg.SaveConfig {
+				var endpoints *quick.EndpointMap
+				if resolver != nil {
+					endpoints = resolver.EndpointMap()
+				}
+				if err := quick.SaveConfig(cfg, iface, endpoints); err != nil {
+					entry.WithError(err).Errorln("failed to save config")
+				}
+			}
+
+			if syncLazy {
+				startLazyManager(ctx, iface, cfg.Peers, entry)
+				background = true
 			}
 		}
+
+		if background {
+			logrus.Infoln("sync: --resolve-dynamic/--lazy requested, staying resident until interrupted")
+			<-ctx.Done()
+		}
 	},
 }
 
+// startResolver creates a Resolver for iface's hostname:port peers, if any,
+// and resolves them once synchronously before returning, so a caller that
+// only needs the EndpointMap populated (such as SaveConfig) doesn't have to
+// wait for Run's first tick.
+//
+// This only integrates the resolver into sync; there is no up command in
+// this tree to integrate it into as well.
+func startResolver(iface string, log *logrus.Entry) *quick.Resolver {
+	unresolved, err := quick.GetUnresolvedEndpoints(iface)
+	if err != nil {
+		log.WithError(err).Error("failed to collect unresolved endpoints")
+		return nil
+	}
+	if len(unresolved) == 0 {
+		return nil
+	}
+	resolver := quick.NewResolver(iface, unresolved, log)
+	resolver.ResolveOnce()
+	return resolver
+}
+
+// startLazyManager launches a background LazyManager over peers, evicting
+// idle ones from the device and re-adding them once traffic to their
+// AllowedIPs resumes.
+//
+// The --lazy flags live on sync rather than an up command invoked right
+// after bringing the interface up, because this tree has no up command at
+// all; sync is the only place with a resolved interface and peer list to
+// hang them off. Move them when up exists.
+func startLazyManager(ctx context.Context, iface string, peers []wgtypes.PeerConfig, log *logrus.Entry) {
+	manager := quick.NewLazyManager(iface, peers, log)
+	manager.LazyIdleThreshold = syncLazyIdleTimeout
+	manager.PollInterval = syncLazyPollInterval
+	go manager.Run(ctx)
+}
+
 func init() {
+	syncCmd.Flags().BoolVar(&syncResolveDynamic, "resolve-dynamic", false, "keep re-resolving hostname:port peer endpoints in the background (stays resident until interrupted)")
+	syncCmd.Flags().BoolVar(&syncLazy, "lazy", false, "evict idle peers from the device and re-add them on demand (stays resident until interrupted)")
+	syncCmd.Flags().DurationVar(&syncLazyIdleTimeout, "lazy-idle-threshold", quick.DefaultLazyIdleThreshold, "how long a peer may go without a handshake before --lazy evicts it")
+	syncCmd.Flags().DurationVar(&syncLazyPollInterval, "lazy-poll-interval", quick.DefaultLazyPollInterval, "how often --lazy checks handshake ages")
 	rootCmd.AddCommand(syncCmd)
 }
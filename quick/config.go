@@ -112,10 +112,14 @@ PrivateKey = {{ .PrivateKey | wgKey }}
 {{- if .ListenPort }}{{ "\n" }}ListenPort = {{ .ListenPort }}{{ end }}
 {{- if .MTU }}{{ "\n" }}MTU = {{ .MTU }}{{ end }}
 {{- if .Table }}{{ "\n" }}Table = {{ .Table }}{{ end }}
-{{- if .PreUp }}{{ "\n" }}PreUp = {{ .PreUp }}{{ end }}
-{{- if .PostUp }}{{ "\n" }}PostUp = {{ .PostUp }}{{ end }}
-{{- if .PreDown }}{{ "\n" }}PreDown = {{ .PreDown }}{{ end }}
-{{- if .PostDown }}{{ "\n" }}PostDown = {{ .PostDown }}{{ end }}
+{{- if .RouteMetric }}{{ "\n" }}RouteMetric = {{ .RouteMetric }}{{ end }}
+{{- if .RouteProtocol }}{{ "\n" }}RouteProtocol = {{ .RouteProtocol }}{{ end }}
+{{- if .AddressLabel }}{{ "\n" }}AddressLabel = {{ .AddressLabel }}{{ end }}
+{{- if .WgBin }}{{ "\n" }}WgBin = {{ .WgBin }}{{ end }}
+{{- range .PreUp }}{{ "\n" }}PreUp = {{ . }}{{ end }}
+{{- range .PostUp }}{{ "\n" }}PostUp = {{ . }}{{ end }}
+{{- range .PreDown }}{{ "\n" }}PreDown = {{ . }}{{ end }}
+{{- range .PostDown }}{{ "\n" }}PostDown = {{ . }}{{ end }}
 {{- if .SaveConfig }}{{ "\n" }}SaveConfig = {{ .SaveConfig }}{{ end }}
 {{- range .Peers }}
 {{- "\n" }}
@@ -361,6 +365,20 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 		cfg.PrivateKey = &key
 	case "WgBin":
 		cfg.WgBin = rhs
+	case "RouteMetric":
+		metric, err := strconv.ParseInt(rhs, 10, 64)
+		if err != nil {
+			return err
+		}
+		cfg.RouteMetric = int(metric)
+	case "RouteProtocol":
+		proto, err := strconv.ParseInt(rhs, 10, 64)
+		if err != nil {
+			return err
+		}
+		cfg.RouteProtocol = int(proto)
+	case "AddressLabel":
+		cfg.AddressLabel = rhs
 	default:
 		return fmt.Errorf("unknown directive %s", lhs)
 	}
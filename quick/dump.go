@@ -0,0 +1,203 @@
+package quick
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DumpConfig is the parsed form of `wg show <iface> dump`.
+type DumpConfig struct {
+	PrivateKey   *wgtypes.Key
+	PublicKey    *wgtypes.Key
+	ListenPort   int
+	FirewallMark *int
+
+	Peers []DumpPeer
+}
+
+// DumpPeer is one peer line of `wg show <iface> dump`.
+type DumpPeer struct {
+	PublicKey           wgtypes.Key
+	PresharedKey        *wgtypes.Key
+	Endpoint            *net.UDPAddr
+	AllowedIPs          []net.IPNet
+	LatestHandshake     time.Time
+	RxBytes             int64
+	TxBytes             int64
+	PersistentKeepalive time.Duration
+}
+
+// ShowDump runs `wg show <iface> dump` and returns its raw tab-separated
+// output for ParseDump.
+func ShowDump(iface string) ([]byte, error) {
+	out, err := exec.Command("wg", "show", iface, "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot run wg show %s dump: %v", iface, err)
+	}
+	return out, nil
+}
+
+// ParseDump parses the output of `wg show <iface> dump`: the first line is
+// the interface (private-key, public-key, listen-port, fwmark, with
+// "(none)"/"off" sentinels for unset values), and each following line is a
+// peer with 8 tab-separated fields.
+func ParseDump(b []byte) (*DumpConfig, error) {
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("cannot parse dump: empty output")
+	}
+
+	cfg, err := parseDumpInterfaceLine(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("[line 1]: %v", err)
+	}
+
+	for no, line := range lines[1:] {
+		peer, err := parseDumpPeerLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("[line %d]: %v", no+2, err)
+		}
+		cfg.Peers = append(cfg.Peers, *peer)
+	}
+
+	return cfg, nil
+}
+
+func parseDumpInterfaceLine(line string) (*DumpConfig, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected 4 fields, got %d", len(fields))
+	}
+
+	cfg := &DumpConfig{}
+
+	if fields[0] != "(none)" {
+		key, err := wgtypes.ParseKey(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse private key: %v", err)
+		}
+		cfg.PrivateKey = &key
+	}
+	if fields[1] != "(none)" {
+		key, err := wgtypes.ParseKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse public key: %v", err)
+		}
+		cfg.PublicKey = &key
+	}
+
+	port, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse listen port: %v", err)
+	}
+	cfg.ListenPort = port
+
+	if fields[3] != "off" {
+		mark, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse fwmark: %v", err)
+		}
+		cfg.FirewallMark = &mark
+	}
+
+	return cfg, nil
+}
+
+func parseDumpPeerLine(line string) (*DumpPeer, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 8 {
+		return nil, fmt.Errorf("expected 8 fields, got %d", len(fields))
+	}
+
+	peer := &DumpPeer{}
+
+	key, err := wgtypes.ParseKey(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse public key: %v", err)
+	}
+	peer.PublicKey = key
+
+	if fields[1] != "(none)" {
+		psk, err := wgtypes.ParseKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse preshared key: %v", err)
+		}
+		peer.PresharedKey = &psk
+	}
+
+	if fields[2] != "(none)" {
+		addr, err := net.ResolveUDPAddr("", fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse endpoint: %v", err)
+		}
+		peer.Endpoint = addr
+	}
+
+	if fields[3] != "(none)" {
+		for _, addr := range strings.Split(fields[3], ",") {
+			ip, cidr, err := net.ParseCIDR(strings.TrimSpace(addr))
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse allowed ip %s: %v", addr, err)
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, net.IPNet{IP: ip, Mask: cidr.Mask})
+		}
+	}
+
+	handshake, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse latest handshake: %v", err)
+	}
+	if handshake != 0 {
+		peer.LatestHandshake = time.Unix(handshake, 0)
+	}
+
+	rx, err := strconv.ParseInt(fields[5], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse rx bytes: %v", err)
+	}
+	peer.RxBytes = rx
+
+	tx, err := strconv.ParseInt(fields[6], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse tx bytes: %v", err)
+	}
+	peer.TxBytes = tx
+
+	if fields[7] != "off" {
+		keepalive, err := strconv.ParseInt(fields[7], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse persistent keepalive: %v", err)
+		}
+		peer.PersistentKeepalive = time.Duration(keepalive) * time.Second
+	}
+
+	return peer, nil
+}
+
+// DiscoverNATEndpoints returns the endpoints of peers on iface whose latest
+// handshake is within maxAge. A recent handshake is the only signal that a
+// peer's endpoint, which may have been learned from an incoming packet
+// behind a NAT rather than configured, is actually reachable; mesh
+// controllers should not trust a stale one.
+func DiscoverNATEndpoints(iface string, maxAge time.Duration) (map[wgtypes.Key]*net.UDPAddr, error) {
+	dump, err := PeerStatusDump(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[wgtypes.Key]*net.UDPAddr)
+	cutoff := time.Now().Add(-maxAge)
+	for _, p := range dump.Peers {
+		if p.Endpoint == nil || p.LatestHandshake.Before(cutoff) {
+			continue
+		}
+		endpoints[p.PublicKey] = p.Endpoint
+	}
+	return endpoints, nil
+}
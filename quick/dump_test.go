@@ -0,0 +1,191 @@
+package quick
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDumpInterfaceLine(t *testing.T) {
+	privkey := mustKey(t, 0x01).String()
+	pubkey := mustKey(t, 0x02).String()
+
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+		check   func(t *testing.T, cfg *DumpConfig)
+	}{
+		{
+			name: "fully populated",
+			line: strings.Join([]string{privkey, pubkey, "51820", "51"}, "\t"),
+			check: func(t *testing.T, cfg *DumpConfig) {
+				if cfg.PrivateKey == nil || cfg.PrivateKey.String() != privkey {
+					t.Errorf("PrivateKey = %v, want %s", cfg.PrivateKey, privkey)
+				}
+				if cfg.PublicKey == nil || cfg.PublicKey.String() != pubkey {
+					t.Errorf("PublicKey = %v, want %s", cfg.PublicKey, pubkey)
+				}
+				if cfg.ListenPort != 51820 {
+					t.Errorf("ListenPort = %d, want 51820", cfg.ListenPort)
+				}
+				if cfg.FirewallMark == nil || *cfg.FirewallMark != 51 {
+					t.Errorf("FirewallMark = %v, want 51", cfg.FirewallMark)
+				}
+			},
+		},
+		{
+			name: "none and off sentinels",
+			line: strings.Join([]string{"(none)", "(none)", "0", "off"}, "\t"),
+			check: func(t *testing.T, cfg *DumpConfig) {
+				if cfg.PrivateKey != nil {
+					t.Errorf("PrivateKey = %v, want nil", cfg.PrivateKey)
+				}
+				if cfg.PublicKey != nil {
+					t.Errorf("PublicKey = %v, want nil", cfg.PublicKey)
+				}
+				if cfg.FirewallMark != nil {
+					t.Errorf("FirewallMark = %v, want nil", cfg.FirewallMark)
+				}
+			},
+		},
+		{
+			name:    "wrong field count",
+			line:    strings.Join([]string{"(none)", "(none)", "0"}, "\t"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseDumpInterfaceLine(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("parseDumpInterfaceLine(): want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDumpInterfaceLine() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestParseDumpPeerLine(t *testing.T) {
+	pubkey := mustKey(t, 0x03).String()
+	psk := mustKey(t, 0x04).String()
+
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+		check   func(t *testing.T, peer *DumpPeer)
+	}{
+		{
+			name: "fully populated, never handshaked",
+			line: strings.Join([]string{pubkey, psk, "192.0.2.1:51820", "10.0.0.2/32,10.0.0.3/32", "0", "100", "200", "25"}, "\t"),
+			check: func(t *testing.T, peer *DumpPeer) {
+				if peer.PresharedKey == nil || peer.PresharedKey.String() != psk {
+					t.Errorf("PresharedKey = %v, want %s", peer.PresharedKey, psk)
+				}
+				if peer.Endpoint == nil || peer.Endpoint.String() != "192.0.2.1:51820" {
+					t.Errorf("Endpoint = %v, want 192.0.2.1:51820", peer.Endpoint)
+				}
+				if len(peer.AllowedIPs) != 2 {
+					t.Fatalf("len(AllowedIPs) = %d, want 2", len(peer.AllowedIPs))
+				}
+				if !peer.LatestHandshake.IsZero() {
+					t.Errorf("LatestHandshake = %v, want zero value for a never-handshaked peer", peer.LatestHandshake)
+				}
+				if peer.RxBytes != 100 || peer.TxBytes != 200 {
+					t.Errorf("RxBytes/TxBytes = %d/%d, want 100/200", peer.RxBytes, peer.TxBytes)
+				}
+				if peer.PersistentKeepalive != 25*time.Second {
+					t.Errorf("PersistentKeepalive = %v, want 25s", peer.PersistentKeepalive)
+				}
+			},
+		},
+		{
+			name: "none sentinels and a real handshake",
+			line: strings.Join([]string{pubkey, "(none)", "(none)", "(none)", "1700000000", "0", "0", "off"}, "\t"),
+			check: func(t *testing.T, peer *DumpPeer) {
+				if peer.PresharedKey != nil {
+					t.Errorf("PresharedKey = %v, want nil", peer.PresharedKey)
+				}
+				if peer.Endpoint != nil {
+					t.Errorf("Endpoint = %v, want nil", peer.Endpoint)
+				}
+				if peer.AllowedIPs != nil {
+					t.Errorf("AllowedIPs = %v, want nil", peer.AllowedIPs)
+				}
+				if peer.LatestHandshake != time.Unix(1700000000, 0) {
+					t.Errorf("LatestHandshake = %v, want %v", peer.LatestHandshake, time.Unix(1700000000, 0))
+				}
+				if peer.PersistentKeepalive != 0 {
+					t.Errorf("PersistentKeepalive = %v, want 0", peer.PersistentKeepalive)
+				}
+			},
+		},
+		{
+			name:    "wrong field count",
+			line:    strings.Join([]string{pubkey, "(none)"}, "\t"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, err := parseDumpPeerLine(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("parseDumpPeerLine(): want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDumpPeerLine() error = %v", err)
+			}
+			tt.check(t, peer)
+		})
+	}
+}
+
+func TestParseDump(t *testing.T) {
+	privkey := mustKey(t, 0x05).String()
+	pubkey := mustKey(t, 0x06).String()
+	peerKey := mustKey(t, 0x07).String()
+
+	dump := strings.Join([]string{
+		strings.Join([]string{privkey, pubkey, "51820", "off"}, "\t"),
+		strings.Join([]string{peerKey, "(none)", "(none)", "(none)", "0", "0", "0", "off"}, "\t"),
+	}, "\n")
+
+	cfg, err := ParseDump([]byte(dump))
+	if err != nil {
+		t.Fatalf("ParseDump() error = %v", err)
+	}
+	if len(cfg.Peers) != 1 {
+		t.Fatalf("len(cfg.Peers) = %d, want 1", len(cfg.Peers))
+	}
+	if cfg.Peers[0].PublicKey.String() != peerKey {
+		t.Errorf("Peers[0].PublicKey = %s, want %s", cfg.Peers[0].PublicKey.String(), peerKey)
+	}
+}
+
+func TestParseDumpEmpty(t *testing.T) {
+	if _, err := ParseDump([]byte("")); err == nil {
+		t.Fatal("ParseDump(\"\"): want error, got nil")
+	}
+}
+
+func TestParseDumpBadPeerLine(t *testing.T) {
+	privkey := mustKey(t, 0x08).String()
+	pubkey := mustKey(t, 0x09).String()
+	dump := strings.Join([]string{privkey, pubkey, "51820", "off"}, "\t") + "\n" + "garbage\tline"
+
+	if _, err := ParseDump([]byte(dump)); err == nil {
+		t.Fatal("ParseDump() with a malformed peer line: want error, got nil")
+	}
+}
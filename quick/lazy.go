@@ -0,0 +1,237 @@
+package quick
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultLazyIdleThreshold is how long a peer may go without a handshake
+// before LazyManager evicts it from the live device.
+const DefaultLazyIdleThreshold = 5 * time.Minute
+
+// DefaultLazyPollInterval is how often LazyManager checks handshake ages.
+const DefaultLazyPollInterval = 30 * time.Second
+
+// DefaultRouteMissPollInterval is how often LazyManager scans conntrack for
+// traffic addressed to an evicted peer.
+const DefaultRouteMissPollInterval = 2 * time.Second
+
+// conntrackPath is where the kernel exposes the connection-tracking table
+// that pollConntrack scans for traffic towards evicted peers.
+const conntrackPath = "/proc/net/nf_conntrack"
+
+// LazyManager keeps the full desired peer set in memory but only the
+// peers with recent traffic configured on the live device. Gateways that
+// statically list hundreds of peers but only ever talk to a handful at a
+// time save the crypto and handshake overhead of the rest.
+type LazyManager struct {
+	Iface string
+
+	// LazyIdleThreshold is how long a peer may go without a handshake
+	// before it's evicted.
+	LazyIdleThreshold time.Duration
+	// PollInterval is how often handshake ages are checked.
+	PollInterval time.Duration
+	// RouteMissPollInterval is how often the conntrack fallback (used when
+	// nothing calls OnPacket directly, e.g. a packet sniffer on the TUN)
+	// scans for traffic addressed to an evicted peer.
+	RouteMissPollInterval time.Duration
+
+	mu        sync.Mutex
+	desired   map[wgtypes.Key]wgtypes.PeerConfig
+	active    map[wgtypes.Key]bool
+	firstSeen map[wgtypes.Key]time.Time
+
+	log *logrus.Entry
+}
+
+// NewLazyManager creates a LazyManager for iface with desired as the full
+// peer set; all peers start out considered active, since Up is expected to
+// have already configured them on the device.
+func NewLazyManager(iface string, desired []wgtypes.PeerConfig, log *logrus.Entry) *LazyManager {
+	m := &LazyManager{
+		Iface:                 iface,
+		LazyIdleThreshold:     DefaultLazyIdleThreshold,
+		PollInterval:          DefaultLazyPollInterval,
+		RouteMissPollInterval: DefaultRouteMissPollInterval,
+		desired:               make(map[wgtypes.Key]wgtypes.PeerConfig, len(desired)),
+		active:                make(map[wgtypes.Key]bool, len(desired)),
+		firstSeen:             make(map[wgtypes.Key]time.Time, len(desired)),
+		log:                   log,
+	}
+	now := time.Now()
+	for _, p := range desired {
+		m.desired[p.PublicKey] = p
+		m.active[p.PublicKey] = true
+		m.firstSeen[p.PublicKey] = now
+	}
+	return m
+}
+
+// Run blocks, evicting idle peers every PollInterval and scanning conntrack
+// for traffic towards evicted peers every RouteMissPollInterval, until ctx
+// is cancelled.
+func (m *LazyManager) Run(ctx context.Context) {
+	evictTicker := time.NewTicker(m.PollInterval)
+	defer evictTicker.Stop()
+	missTicker := time.NewTicker(m.RouteMissPollInterval)
+	defer missTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-evictTicker.C:
+			m.evictIdle()
+		case <-missTicker.C:
+			m.pollConntrack()
+		}
+	}
+}
+
+func (m *LazyManager) evictIdle() {
+	dump, err := PeerStatusDump(m.Iface)
+	if err != nil {
+		m.log.WithError(err).Error("lazy: cannot query device")
+		return
+	}
+	lastHandshake := make(map[wgtypes.Key]time.Time, len(dump.Peers))
+	for _, p := range dump.Peers {
+		lastHandshake[p.PublicKey] = p.LatestHandshake
+	}
+
+	cutoff := time.Now().Add(-m.LazyIdleThreshold)
+
+	m.mu.Lock()
+	var toEvict []wgtypes.Key
+	for pubkey := range m.desired {
+		if !m.active[pubkey] {
+			continue
+		}
+		// A peer that has never completed a handshake has no entry (or a
+		// zero one) in lastHandshake; that must not be read as "just
+		// connected", or a peer that's never been used - exactly the ones
+		// this feature targets - would never age out. Fall back to when
+		// the manager first saw the peer (reset on every re-add).
+		idleSince := m.firstSeen[pubkey]
+		if hs, known := lastHandshake[pubkey]; known && !hs.IsZero() {
+			idleSince = hs
+		}
+		if idleSince.After(cutoff) {
+			continue
+		}
+		toEvict = append(toEvict, pubkey)
+	}
+	m.mu.Unlock()
+
+	for _, pubkey := range toEvict {
+		if err := m.configurePeer(wgtypes.PeerConfig{PublicKey: pubkey, Remove: true}); err != nil {
+			m.log.WithError(err).WithField("peer", pubkey).Error("lazy: cannot evict idle peer")
+			continue
+		}
+		m.mu.Lock()
+		m.active[pubkey] = false
+		m.mu.Unlock()
+		m.log.WithField("peer", pubkey).Info("lazy: evicted idle peer")
+	}
+}
+
+// pollConntrack scans the kernel's connection-tracking table for traffic
+// addressed to a currently-evicted peer, and re-adds it via OnPacket if
+// found. As of this tree, this is the only source that ever calls OnPacket:
+// nothing instantiates a LazyManager and a quick/userspace.UserspaceIface
+// together and wires ObserveOutbound to it, so a peer behind a kernel TUN or
+// a userspace one is only ever re-added once its traffic shows up in
+// conntrack, not the instant a packet for it is sent. pollConntrack is a
+// no-op, not an error, on hosts without conntrack, such as non-Linux dev
+// boxes.
+func (m *LazyManager) pollConntrack() {
+	m.mu.Lock()
+	anyEvicted := false
+	for _, active := range m.active {
+		if !active {
+			anyEvicted = true
+			break
+		}
+	}
+	m.mu.Unlock()
+	if !anyEvicted {
+		return
+	}
+
+	b, err := os.ReadFile(conntrackPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		for _, field := range strings.Fields(line) {
+			dst, ok := strings.CutPrefix(field, "dst=")
+			if !ok {
+				continue
+			}
+			if ip := net.ParseIP(dst); ip != nil {
+				m.OnPacket(ip)
+			}
+		}
+	}
+}
+
+// OnPacket should be called with the destination IP of a packet observed on
+// the tunnel's outbound path - e.g. from a packet sniffer on the TUN, such
+// as quick/userspace's UserspaceIface.ObserveOutbound. If dst matches an
+// evicted peer's AllowedIPs, that peer alone is re-added to the live
+// device. Nothing in this tree calls ObserveOutbound today; pollConntrack
+// is the only thing that actually drives OnPacket (see its comment).
+func (m *LazyManager) OnPacket(dst net.IP) {
+	m.mu.Lock()
+	pubkey, peer, ok := m.matchEvictedLocked(dst)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	peer.Remove = false
+	peer.UpdateOnly = false
+	if err := m.configurePeer(peer); err != nil {
+		m.log.WithError(err).WithField("peer", pubkey).Error("lazy: cannot re-add peer")
+		return
+	}
+
+	m.mu.Lock()
+	m.active[pubkey] = true
+	m.firstSeen[pubkey] = time.Now()
+	m.mu.Unlock()
+	m.log.WithField("peer", pubkey).Info("lazy: re-added peer on demand")
+}
+
+func (m *LazyManager) matchEvictedLocked(dst net.IP) (wgtypes.Key, wgtypes.PeerConfig, bool) {
+	for pubkey, active := range m.active {
+		if active {
+			continue
+		}
+		peer := m.desired[pubkey]
+		for _, allowed := range peer.AllowedIPs {
+			if allowed.Contains(dst) {
+				return pubkey, peer, true
+			}
+		}
+	}
+	return wgtypes.Key{}, wgtypes.PeerConfig{}, false
+}
+
+func (m *LazyManager) configurePeer(peer wgtypes.PeerConfig) error {
+	c, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("cannot open wgctrl client: %v", err)
+	}
+	defer c.Close()
+	return c.ConfigureDevice(m.Iface, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}})
+}
@@ -0,0 +1,186 @@
+package quick
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// EndpointMap remembers, for each resolved UDP endpoint, the original
+// hostname:port it came from, so that re-resolving or rewriting the config
+// file does not lose a dynamic-DNS name in favour of whatever IP it last
+// resolved to.
+type EndpointMap struct {
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+func newEndpointMap() *EndpointMap {
+	return &EndpointMap{m: make(map[string]string)}
+}
+
+// Set records that resolvedAddr ("ip:port") was resolved from original
+// ("host:port").
+func (e *EndpointMap) Set(resolvedAddr, original string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.m[resolvedAddr] = original
+}
+
+// Lookup returns the original host:port a resolved address came from, if
+// any.
+func (e *EndpointMap) Lookup(resolvedAddr string) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	original, ok := e.m[resolvedAddr]
+	return original, ok
+}
+
+// Resolver periodically re-resolves a set of peer endpoints that were given
+// as hostname:port rather than a bare IP, and pushes any change in the
+// resolved address to the live device via wgctrl. This keeps peers behind
+// dynamic DNS reachable without requiring the interface to be restarted.
+type Resolver struct {
+	Iface string
+
+	// Interval between re-resolve passes.
+	Interval time.Duration
+	// Jitter randomizes each pass's delay by up to this much, so that many
+	// resolvers started at once don't all query DNS in lockstep.
+	Jitter time.Duration
+	// DNSTimeout bounds each individual lookup.
+	DNSTimeout time.Duration
+
+	endpoints map[wgtypes.Key]string
+	reverse   *EndpointMap
+	log       *logrus.Entry
+}
+
+// NewResolver creates a Resolver for iface from the unresolved hostname:port
+// endpoints previously collected by GetUnresolvedEndpoints.
+func NewResolver(iface string, unresolved map[wgtypes.Key]string, log *logrus.Entry) *Resolver {
+	return &Resolver{
+		Iface:      iface,
+		Interval:   30 * time.Second,
+		Jitter:     5 * time.Second,
+		DNSTimeout: 5 * time.Second,
+		endpoints:  unresolved,
+		reverse:    newEndpointMap(),
+		log:        log,
+	}
+}
+
+// EndpointMap exposes the reverse hostname map so that other subsystems
+// (such as SaveConfig) can recover the original host:port for a peer whose
+// endpoint is currently a bare IP.
+func (r *Resolver) EndpointMap() *EndpointMap {
+	return r.reverse
+}
+
+// Run blocks, re-resolving endpoints on Interval (plus jitter) until ctx is
+// cancelled.
+func (r *Resolver) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.nextDelay()):
+			r.ResolveOnce()
+		}
+	}
+}
+
+func (r *Resolver) nextDelay() time.Duration {
+	if r.Jitter <= 0 {
+		return r.Interval
+	}
+	return r.Interval + time.Duration(rand.Int63n(int64(r.Jitter)))
+}
+
+// ResolveOnce runs a single re-resolve pass immediately, rather than
+// waiting for Run's next tick. Callers that need EndpointMap populated
+// before Run's first tick (e.g. SaveConfig right after sync) should call
+// this directly.
+func (r *Resolver) ResolveOnce() {
+	if len(r.endpoints) == 0 {
+		return
+	}
+
+	c, err := wgctrl.New()
+	if err != nil {
+		r.log.WithError(err).Error("resolver: cannot open wgctrl client")
+		return
+	}
+	defer c.Close()
+
+	device, err := c.Device(r.Iface)
+	if err != nil {
+		r.log.WithError(err).Error("resolver: cannot query device")
+		return
+	}
+
+	for pubkey, hostport := range r.endpoints {
+		addr, err := resolveWithTimeout(hostport, r.DNSTimeout)
+		if err != nil {
+			r.log.WithError(err).WithField("endpoint", hostport).Warn("resolver: cannot resolve endpoint")
+			continue
+		}
+		r.reverse.Set(addr.String(), hostport)
+
+		if current := devicePeerEndpoint(device, pubkey); current != nil && current.String() == addr.String() {
+			continue
+		}
+
+		err = c.ConfigureDevice(r.Iface, wgtypes.Config{
+			Peers: []wgtypes.PeerConfig{
+				{
+					PublicKey:  pubkey,
+					UpdateOnly: true,
+					Endpoint:   addr,
+				},
+			},
+		})
+		if err != nil {
+			r.log.WithError(err).WithField("endpoint", hostport).Error("resolver: cannot update peer endpoint")
+			continue
+		}
+		r.log.WithFields(logrus.Fields{"endpoint": hostport, "resolved": addr.String()}).Info("resolver: updated peer endpoint")
+	}
+}
+
+func devicePeerEndpoint(device *wgtypes.Device, pubkey wgtypes.Key) *net.UDPAddr {
+	for _, p := range device.Peers {
+		if p.PublicKey == pubkey {
+			return p.Endpoint
+		}
+	}
+	return nil
+}
+
+func resolveWithTimeout(hostport string, timeout time.Duration) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, fmt.Errorf("cannot split %s: %v", hostport, err)
+	}
+
+	resolver := net.Resolver{}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot look up %s: %v", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	return net.ResolveUDPAddr("udp", net.JoinHostPort(ips[0].IP.String(), port))
+}
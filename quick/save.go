@@ -0,0 +1,124 @@
+package quick
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// SaveConfig implements the wg-quick `SaveConfig = true` directive: it reads
+// back the live state of iface through wgctrl, merges the keys, peers,
+// listen port and fwmark it finds there into cfg (directives that don't live
+// on the kernel device, such as Address, DNS, MTU, Table and the PrePost
+// hooks, are left untouched), and atomically rewrites
+// /etc/wireguard/<iface>.conf with the result. If endpoints is non-nil, any
+// peer endpoint that matches a known resolved address is written back using
+// its original hostname:port so a dynamic-DNS peer isn't frozen to whatever
+// IP it last resolved to.
+func SaveConfig(cfg *Config, iface string, endpoints *EndpointMap) error {
+	c, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("cannot open wgctrl client: %v", err)
+	}
+	defer c.Close()
+
+	device, err := c.Device(iface)
+	if err != nil {
+		return fmt.Errorf("cannot query device %s: %v", iface, err)
+	}
+
+	merged := *cfg
+	mergeDeviceState(&merged, device)
+
+	text, err := merged.MarshalText()
+	if err != nil {
+		return fmt.Errorf("cannot marshal merged config: %v", err)
+	}
+	if endpoints != nil {
+		text = restoreEndpointHostnames(text, endpoints)
+	}
+
+	return atomicWriteConfigFile(iface, text)
+}
+
+func mergeDeviceState(cfg *Config, device *wgtypes.Device) {
+	privateKey := device.PrivateKey
+	cfg.PrivateKey = &privateKey
+	listenPort := device.ListenPort
+	cfg.ListenPort = &listenPort
+	firewallMark := device.FirewallMark
+	cfg.FirewallMark = &firewallMark
+
+	cfg.Peers = nil
+	for _, p := range device.Peers {
+		cfg.Peers = append(cfg.Peers, peerConfigFromPeer(p))
+	}
+}
+
+// peerConfigFromPeer narrows a live wgtypes.Peer down to the subset of
+// fields the config marshaller understands.
+func peerConfigFromPeer(p wgtypes.Peer) wgtypes.PeerConfig {
+	peerCfg := wgtypes.PeerConfig{
+		PublicKey:  p.PublicKey,
+		Endpoint:   p.Endpoint,
+		AllowedIPs: p.AllowedIPs,
+	}
+	if p.PresharedKey != (wgtypes.Key{}) {
+		psk := p.PresharedKey
+		peerCfg.PresharedKey = &psk
+	}
+	if p.PersistentKeepaliveInterval != 0 {
+		keepalive := p.PersistentKeepaliveInterval
+		peerCfg.PersistentKeepaliveInterval = &keepalive
+	}
+	return peerCfg
+}
+
+func restoreEndpointHostnames(text []byte, endpoints *EndpointMap) []byte {
+	lines := strings.Split(string(text), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "Endpoint = ") {
+			continue
+		}
+		addr := strings.TrimPrefix(trimmed, "Endpoint = ")
+		if original, ok := endpoints.Lookup(addr); ok {
+			lines[i] = "Endpoint = " + original
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// atomicWriteConfigFile writes text to /etc/wireguard/<iface>.conf via a
+// temp file + rename so readers never see a partially-written config, with
+// mode 0600 since the file contains the interface's private key.
+func atomicWriteConfigFile(iface string, text []byte) error {
+	dir := "/etc/wireguard"
+	tmp, err := os.CreateTemp(dir, "."+iface+".conf.*")
+	if err != nil {
+		return fmt.Errorf("cannot create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot chmod temp file: %v", err)
+	}
+	if _, err := tmp.Write(text); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write temp file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot close temp file: %v", err)
+	}
+
+	dst := filepath.Join(dir, iface+".conf")
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("cannot rename temp file into place: %v", err)
+	}
+	return nil
+}
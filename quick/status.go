@@ -28,3 +28,15 @@ func PeerStatus(iface string) (map[wgtypes.Key]*wgtypes.Peer, error) {
 	}
 	return peers, nil
 }
+
+// PeerStatusDump returns the same live peer status as PeerStatus, but backed
+// by `wg show <iface> dump` rather than wgctrl, giving access to fields such
+// as LatestHandshake that callers use to validate an endpoint before
+// trusting it.
+func PeerStatusDump(iface string) (*DumpConfig, error) {
+	b, err := ShowDump(iface)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDump(b)
+}
@@ -0,0 +1,97 @@
+package quick
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// PeerConfig is a wgtypes.PeerConfig with a UAPI marshaller attached. It is
+// defined locally (rather than aliased) so ToUAPI can be hung off it without
+// reaching into wgtypes.
+type PeerConfig wgtypes.PeerConfig
+
+// ToUAPI renders cfg as a WireGuard UAPI "set" transaction: private_key,
+// listen_port, fwmark, replace_peers=true, followed by each peer block, all
+// terminated by a blank line. The result can be written directly to
+// wireguard-go's UAPI socket or handed to wgctrl.Client.ConfigureDevice after
+// parsing it back, which lets callers skip the wg-quick INI template
+// entirely.
+func (cfg *Config) ToUAPI() (string, error) {
+	if cfg.PrivateKey == nil {
+		return "", fmt.Errorf("cannot marshal UAPI config: no private key set")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "private_key=%s\n", hex.EncodeToString(cfg.PrivateKey[:]))
+	if cfg.ListenPort != nil {
+		fmt.Fprintf(&b, "listen_port=%d\n", *cfg.ListenPort)
+	}
+	if cfg.FirewallMark != nil {
+		fmt.Fprintf(&b, "fwmark=%d\n", *cfg.FirewallMark)
+	}
+	b.WriteString("replace_peers=true\n")
+
+	for _, p := range cfg.Peers {
+		// A full config push always wants each peer's AllowedIPs set
+		// wholesale, regardless of whether the caller's PeerConfig had
+		// ReplaceAllowedIPs set - unlike ToUAPI's single-peer-update reuse,
+		// where the flag means what it says.
+		peerCfg := PeerConfig(p)
+		peerCfg.ReplaceAllowedIPs = true
+		peerUAPI, err := peerCfg.ToUAPI()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(peerUAPI)
+	}
+	b.WriteString("\n")
+
+	return b.String(), nil
+}
+
+// ToUAPI renders p as a single UAPI peer block. Keys are written as
+// lowercase hex (not base64, as the wg-quick text format uses), allowed IPs
+// as cidr/len, and the endpoint as ip:port, bracketing an IPv6 host exactly
+// like the text config parser does - net.ResolveUDPAddr, which wireguard-go
+// uses to parse it back, rejects an unbracketed IPv6 host:port as
+// ambiguous.
+func (p PeerConfig) ToUAPI() (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "public_key=%s\n", hex.EncodeToString(p.PublicKey[:]))
+
+	if p.Remove {
+		b.WriteString("remove=true\n")
+		return b.String(), nil
+	}
+	if p.UpdateOnly {
+		b.WriteString("update_only=true\n")
+	}
+	if p.PresharedKey != nil {
+		fmt.Fprintf(&b, "preshared_key=%s\n", hex.EncodeToString(p.PresharedKey[:]))
+	}
+	if p.Endpoint != nil {
+		fmt.Fprintf(&b, "endpoint=%s\n", flattenEndpoint(p.Endpoint))
+	}
+	if p.PersistentKeepaliveInterval != nil {
+		fmt.Fprintf(&b, "persistent_keepalive_interval=%d\n", toSeconds(*p.PersistentKeepaliveInterval))
+	}
+	if p.ReplaceAllowedIPs {
+		b.WriteString("replace_allowed_ips=true\n")
+	}
+	for _, ip := range p.AllowedIPs {
+		fmt.Fprintf(&b, "allowed_ip=%s\n", ip.String())
+	}
+
+	return b.String(), nil
+}
+
+// flattenEndpoint writes addr as ip:port, bracketing the host when it's
+// IPv6 so the result is unambiguous to parse back.
+func flattenEndpoint(addr *net.UDPAddr) string {
+	return net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port))
+}
@@ -0,0 +1,153 @@
+package quick
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func mustKey(t *testing.T, b byte) wgtypes.Key {
+	t.Helper()
+	var k wgtypes.Key
+	for i := range k {
+		k[i] = b
+	}
+	return k
+}
+
+func TestPeerConfigToUAPI(t *testing.T) {
+	pubkey := mustKey(t, 0x01)
+	psk := mustKey(t, 0x02)
+	keepalive := 25 * time.Second
+	_, allowedIP, _ := net.ParseCIDR("10.0.0.2/32")
+
+	tests := []struct {
+		name string
+		peer PeerConfig
+		want []string // lines that must appear; their order is not checked
+	}{
+		{
+			name: "remove short-circuits everything else",
+			peer: PeerConfig{PublicKey: pubkey, Remove: true, Endpoint: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}},
+			want: []string{
+				"public_key=" + strings.Repeat("01", 32),
+				"remove=true",
+			},
+		},
+		{
+			name: "update only with an IPv4 endpoint",
+			peer: PeerConfig{PublicKey: pubkey, UpdateOnly: true, Endpoint: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}},
+			want: []string{
+				"public_key=" + strings.Repeat("01", 32),
+				"update_only=true",
+				"endpoint=192.0.2.1:51820",
+			},
+		},
+		{
+			name: "IPv6 endpoint is bracketed",
+			peer: PeerConfig{PublicKey: pubkey, Endpoint: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51820}},
+			want: []string{
+				"endpoint=[2001:db8::1]:51820",
+			},
+		},
+		{
+			name: "full set of optional fields",
+			peer: PeerConfig{
+				PublicKey:                   pubkey,
+				PresharedKey:                &psk,
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  []net.IPNet{*allowedIP},
+			},
+			want: []string{
+				"public_key=" + strings.Repeat("01", 32),
+				"preshared_key=" + strings.Repeat("02", 32),
+				"persistent_keepalive_interval=25",
+				"replace_allowed_ips=true",
+				"allowed_ip=10.0.0.2/32",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.peer.ToUAPI()
+			if err != nil {
+				t.Fatalf("ToUAPI() error = %v", err)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(got, line+"\n") {
+					t.Errorf("ToUAPI() = %q, want line %q", got, line)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigToUAPI(t *testing.T) {
+	privkey := mustKey(t, 0xaa)
+	pubkey := mustKey(t, 0xbb)
+	port := 51820
+	mark := 51
+
+	cfg := &Config{
+		Config: wgtypes.Config{
+			PrivateKey:   &privkey,
+			ListenPort:   &port,
+			FirewallMark: &mark,
+			Peers: []wgtypes.PeerConfig{
+				{PublicKey: pubkey},
+			},
+		},
+	}
+
+	got, err := cfg.ToUAPI()
+	if err != nil {
+		t.Fatalf("ToUAPI() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"private_key=" + strings.Repeat("aa", 32),
+		"listen_port=51820",
+		"fwmark=51",
+		"replace_peers=true",
+		"public_key=" + strings.Repeat("bb", 32),
+		// Config.ToUAPI must force replace_allowed_ips on for every peer
+		// regardless of what the source PeerConfig set, since a full push
+		// always replaces each peer's allowed-ip set wholesale.
+		"replace_allowed_ips=true",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("ToUAPI() = %q, want to contain %q", got, want)
+		}
+	}
+
+	if !strings.HasSuffix(got, "\n\n") {
+		t.Errorf("ToUAPI() = %q, want trailing blank line terminator", got)
+	}
+}
+
+func TestConfigToUAPINoPrivateKey(t *testing.T) {
+	cfg := &Config{}
+	if _, err := cfg.ToUAPI(); err == nil {
+		t.Fatal("ToUAPI() with no private key: want error, got nil")
+	}
+}
+
+func TestFlattenEndpoint(t *testing.T) {
+	tests := []struct {
+		addr *net.UDPAddr
+		want string
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}, "192.0.2.1:51820"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51820}, "[2001:db8::1]:51820"},
+	}
+	for _, tt := range tests {
+		if got := flattenEndpoint(tt.addr); got != tt.want {
+			t.Errorf("flattenEndpoint(%v) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
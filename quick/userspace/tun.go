@@ -0,0 +1,142 @@
+package userspace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/tun"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// channelTUN adapts a gVisor channel.Endpoint to wireguard-go's tun.Device,
+// so the wireguard device can read/write raw IP packets against an
+// in-process netstack instead of a kernel /dev/net/tun.
+type channelTUN struct {
+	iface  string
+	ep     *channel.Endpoint
+	events chan tun.Event
+
+	// onOutbound, if set, is called with the destination IP of every
+	// packet read off the tunnel's outbound path - i.e. every packet the
+	// netstack wants to send to a peer. It is set through
+	// UserspaceIface.ObserveOutbound, which accepts LazyManager.OnPacket;
+	// nothing in this tree registers it, so by default it is nil.
+	onOutbound func(dst net.IP)
+
+	closeOnce sync.Once
+}
+
+func newChannelTUN(iface string, ep *channel.Endpoint) *channelTUN {
+	return &channelTUN{
+		iface:  iface,
+		ep:     ep,
+		events: make(chan tun.Event, 1),
+	}
+}
+
+func (t *channelTUN) File() *os.File { return nil }
+
+// Read dequeues the next packet the netstack wants to send out over the
+// tunnel and copies it into bufs[0]; channelTUN only ever fills one of the
+// batch's slots; BatchSize reports that reads and writes by partnering
+// code should not expect more.
+func (t *channelTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	pkt := t.ep.ReadContext(context.Background())
+	if pkt == nil {
+		return 0, fmt.Errorf("%s: tun closed", t.iface)
+	}
+	defer pkt.DecRef()
+
+	view := pkt.ToView()
+	defer view.Release()
+	n := copy(bufs[0][offset:], view.AsSlice())
+	sizes[0] = n
+
+	if t.onOutbound != nil {
+		if dst := destinationIP(bufs[0][offset : offset+n]); dst != nil {
+			t.onOutbound(dst)
+		}
+	}
+
+	return 1, nil
+}
+
+// destinationIP extracts the destination address from a raw IPv4 or IPv6
+// packet, or returns nil if pkt is too short to tell.
+func destinationIP(pkt []byte) net.IP {
+	if len(pkt) == 0 {
+		return nil
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) < 20 {
+			return nil
+		}
+		return net.IP(pkt[16:20])
+	case 6:
+		if len(pkt) < 40 {
+			return nil
+		}
+		return net.IP(pkt[24:40])
+	default:
+		return nil
+	}
+}
+
+// Write injects each raw IP packet received from a peer into the netstack.
+func (t *channelTUN) Write(bufs [][]byte, offset int) (int, error) {
+	written := 0
+	for _, buf := range bufs {
+		data := buf[offset:]
+		if len(data) == 0 {
+			continue
+		}
+
+		var proto tcpip.NetworkProtocolNumber
+		switch data[0] >> 4 {
+		case 4:
+			proto = ipv4.ProtocolNumber
+		case 6:
+			proto = ipv6.ProtocolNumber
+		default:
+			return written, fmt.Errorf("%s: unknown IP version in packet", t.iface)
+		}
+
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(append([]byte(nil), data...)),
+		})
+		t.ep.InjectInbound(proto, pkt)
+		pkt.DecRef()
+		written++
+	}
+
+	return written, nil
+}
+
+func (t *channelTUN) MTU() (int, error) { return int(t.ep.MTU()), nil }
+
+func (t *channelTUN) Name() (string, error) { return t.iface, nil }
+
+// BatchSize reports that channelTUN never batches multiple packets into one
+// Read/Write call; the gVisor channel.Endpoint it wraps hands packets over
+// one at a time.
+func (t *channelTUN) BatchSize() int { return 1 }
+
+func (t *channelTUN) Events() <-chan tun.Event { return t.events }
+
+func (t *channelTUN) Close() error {
+	t.closeOnce.Do(func() {
+		t.events <- tun.EventDown
+		close(t.events)
+		t.ep.Close()
+	})
+	return nil
+}
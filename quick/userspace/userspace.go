@@ -0,0 +1,196 @@
+// Package userspace brings a WireGuard interface up entirely in-process,
+// against a gVisor netstack rather than a kernel TUN. It is used when
+// Config.WgBin is empty (kernel WireGuard is expected) but the kernel TUN
+// itself is unavailable, e.g. in an unprivileged container or a non-Linux
+// dev box - see quick.UserspaceMode.
+package userspace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/hdu-dn11/wg-quick-op/quick"
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+// nicID is the only NIC the netstack ever has, so it needs no discovery.
+const nicID tcpip.NICID = 1
+
+// UserspaceIface is a WireGuard interface with no kernel presence: its TUN
+// is an in-process gVisor netstack, driven by a wireguard-go device.
+// Callers reach the tunnel exclusively through Dial/Listen.
+type UserspaceIface struct {
+	stack *stack.Stack
+	dev   *device.Device
+	tun   *channelTUN
+}
+
+// Up brings iface up against an in-process wireguard-go device, applying
+// cfg through the UAPI marshaller instead of the wg-quick INI template, and
+// shuttling packets through a gVisor netstack rather than a kernel TUN.
+func Up(cfg *quick.Config, iface string) (*UserspaceIface, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{
+			tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol4, icmp.NewProtocol6,
+		},
+	})
+
+	mtu := uint32(cfg.MTU)
+	if mtu == 0 {
+		mtu = device.DefaultMTU
+	}
+
+	ep := channel.New(1024, mtu, "")
+	if err := s.CreateNIC(nicID, ep); err != nil {
+		return nil, fmt.Errorf("%s: cannot create NIC: %v", iface, err)
+	}
+
+	for _, addr := range cfg.Address {
+		if err := addProtocolAddress(s, addr); err != nil {
+			return nil, fmt.Errorf("%s: %v", iface, err)
+		}
+	}
+	s.SetRouteTable([]tcpip.TableEntry{
+		{Destination: header.IPv4EmptySubnet, NIC: nicID},
+		{Destination: header.IPv6EmptySubnet, NIC: nicID},
+	})
+
+	logger := &device.Logger{
+		Verbosef: logrus.WithField("iface", iface).Debugf,
+		Errorf:   logrus.WithField("iface", iface).Errorf,
+	}
+	tunDev := newChannelTUN(iface, ep)
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+
+	uapi, err := cfg.ToUAPI()
+	if err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("%s: cannot marshal UAPI config: %v", iface, err)
+	}
+	if err := dev.IpcSet(uapi); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("%s: cannot apply config: %v", iface, err)
+	}
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("%s: cannot bring device up: %v", iface, err)
+	}
+
+	return &UserspaceIface{stack: s, dev: dev, tun: tunDev}, nil
+}
+
+// ObserveOutbound registers fn to be called with the destination IP of
+// every packet the tunnel sends out to a peer. quick.LazyManager.OnPacket
+// is meant to be passed here, so that demand for an evicted peer is
+// noticed and the peer is re-added.
+func (u *UserspaceIface) ObserveOutbound(fn func(dst net.IP)) {
+	u.tun.onOutbound = fn
+}
+
+func addProtocolAddress(s *stack.Stack, addr net.IPNet) error {
+	ones, _ := addr.Mask.Size()
+
+	proto := tcpip.NetworkProtocolNumber(ipv6.ProtocolNumber)
+	ipBytes := addr.IP.To4()
+	if ipBytes != nil {
+		proto = ipv4.ProtocolNumber
+	} else {
+		ipBytes = addr.IP.To16()
+	}
+
+	protoAddr := tcpip.ProtocolAddress{
+		Protocol: proto,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFromSlice(ipBytes),
+			PrefixLen: ones,
+		},
+	}
+	if err := s.AddProtocolAddress(nicID, protoAddr, stack.AddressProperties{}); err != nil {
+		return fmt.Errorf("cannot assign address %s: %v", addr.IP, err)
+	}
+	return nil
+}
+
+// Dial opens a connection through the tunnel, entirely in userspace - no
+// packet ever touches a kernel socket.
+func (u *UserspaceIface) Dial(network, address string) (net.Conn, error) {
+	full, netProto, err := parseFullAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return gonet.DialContextTCP(context.Background(), u.stack, full, netProto)
+	case "udp", "udp4", "udp6":
+		return gonet.DialUDP(u.stack, nil, &full, netProto)
+	default:
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+}
+
+// Listen accepts connections arriving through the tunnel, entirely in
+// userspace.
+func (u *UserspaceIface) Listen(network, address string) (net.Listener, error) {
+	full, netProto, err := parseFullAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return gonet.ListenTCP(u.stack, full, netProto)
+	default:
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+}
+
+// Close tears down the wireguard device and the netstack beneath it.
+func (u *UserspaceIface) Close() error {
+	u.dev.Close()
+	u.stack.Close()
+	return nil
+}
+
+func parseFullAddress(address string) (tcpip.FullAddress, tcpip.NetworkProtocolNumber, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return tcpip.FullAddress{}, 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return tcpip.FullAddress{}, 0, fmt.Errorf("cannot parse port %q: %v", portStr, err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return tcpip.FullAddress{}, 0, fmt.Errorf("%q is not an IP literal; userspace mode has no resolver", host)
+	}
+
+	netProto := tcpip.NetworkProtocolNumber(ipv6.ProtocolNumber)
+	addrBytes := ip.To4()
+	if addrBytes != nil {
+		netProto = ipv4.ProtocolNumber
+	} else {
+		addrBytes = ip.To16()
+	}
+
+	return tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.AddrFromSlice(addrBytes),
+		Port: uint16(port),
+	}, netProto, nil
+}
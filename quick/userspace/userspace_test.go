@@ -0,0 +1,45 @@
+package userspace
+
+import (
+	"net"
+	"testing"
+
+	"github.com/hdu-dn11/wg-quick-op/quick"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// TestUpDialListen is a smoke test for the userspace path: it brings an
+// interface up against the in-process netstack (no kernel TUN, no peers)
+// and checks that Dial/Listen work against it, since neither needs a peer
+// to exercise the netstack plumbing.
+func TestUpDialListen(t *testing.T) {
+	privkey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("cannot generate private key: %v", err)
+	}
+
+	cfg := &quick.Config{
+		Config: wgtypes.Config{PrivateKey: &privkey},
+		Address: []net.IPNet{
+			{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)},
+		},
+	}
+
+	iface, err := Up(cfg, "utest0")
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	defer iface.Close()
+
+	ln, err := iface.Listen("tcp", "10.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	ln.Close()
+
+	conn, err := iface.Dial("udp", "10.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Close()
+}
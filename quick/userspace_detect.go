@@ -0,0 +1,18 @@
+package quick
+
+import "os"
+
+// UserspaceMode reports whether the kernel TUN device is unavailable on
+// this host (e.g. an unprivileged container, or a non-Linux dev box),
+// meaning callers configured with an empty WgBin should fall back to the
+// quick/userspace gVisor-backed interface instead of trying to create a
+// kernel one.
+//
+// This is library-only for now: this tree has no `up` command to call it
+// from, only `sync`, which assumes the interface already exists. Whatever
+// eventually brings an interface up from a Config should check this before
+// trying to create a kernel TUN, and fall back to quick/userspace.Up.
+func UserspaceMode() bool {
+	_, err := os.Stat("/dev/net/tun")
+	return os.IsNotExist(err)
+}